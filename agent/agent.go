@@ -0,0 +1,61 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package agent wires the interceptors up to a single gRPC server so that
+// agents can accept spans from either the legacy OpenCensus exporters or
+// OpenTelemetry Protocol exporters.
+package agent
+
+import (
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	otlpcollectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+
+	"github.com/census-instrumentation/opencensus-service/interceptor/opencensus"
+	"github.com/census-instrumentation/opencensus-service/interceptor/otlp"
+	"github.com/census-instrumentation/opencensus-service/metricsreceiver"
+	"github.com/census-instrumentation/opencensus-service/spanreceiver"
+)
+
+// NewGRPCServer creates a *grpc.Server with the OpenCensus trace and
+// metrics interceptors and the OTLP trace interceptor all registered, so
+// that a single gRPC listener can accept either the legacy census-agent
+// streaming protocol or OTLP's unary TraceService/Export RPC, and have
+// both deliver into sr and mr. Transport security and authentication
+// configured on the OC interceptor via ocinterceptor.WithTLSConfig and
+// ocinterceptor.WithAuthenticator apply to the whole server.
+func NewGRPCServer(sr spanreceiver.SpanReceiver, mr metricsreceiver.MetricsReceiver, ocOpts ...ocinterceptor.OCOption) (*grpc.Server, error) {
+	oci, err := ocinterceptor.New(sr, ocOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	mi, err := ocinterceptor.NewMetricsInterceptor(mr)
+	if err != nil {
+		return nil, err
+	}
+
+	oti, err := otlpinterceptor.New(oci.SpanReceiver())
+	if err != nil {
+		return nil, err
+	}
+
+	srv := grpc.NewServer(oci.GRPCServerOptions()...)
+	agenttracepb.RegisterTraceServiceServer(srv, oci)
+	agentmetricspb.RegisterMetricsServiceServer(srv, mi)
+	otlpcollectortracepb.RegisterTraceServiceServer(srv, oti)
+	return srv, nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocinterceptor
+
+import (
+	"context"
+	"crypto/tls"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// IdentityAttribute is the key under which an authenticated caller's
+// identity is recorded in a commonpb.Node's Attributes.
+const IdentityAttribute = "oc.auth.identity"
+
+// Authenticator authenticates an incoming gRPC call. It returns a context
+// carrying whatever the authenticator wants downstream code to see (for
+// example, an identity recoverable via IdentityFromContext), or an error if
+// the call should be rejected.
+type Authenticator func(ctx context.Context) (context.Context, error)
+
+// WithTLSConfig configures the gRPC server built by NewGRPCServer to
+// terminate TLS with tlsConfig. Setting tlsConfig.ClientAuth to
+// tls.RequireAndVerifyClientCert (with ClientCAs populated) enables mTLS;
+// the verified client certificate's Subject.CommonName is then recorded as
+// the caller's identity, unless an Authenticator overrides it.
+func WithTLSConfig(tlsConfig *tls.Config) OCOption {
+	return func(oci *OCInterceptor) {
+		oci.tlsConfig = tlsConfig
+	}
+}
+
+// WithAuthenticator sets the Authenticator used to authenticate incoming
+// streams on the gRPC server built by NewGRPCServer.
+func WithAuthenticator(authenticator Authenticator) OCOption {
+	return func(oci *OCInterceptor) {
+		oci.authenticator = authenticator
+	}
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity, if any, that authentication
+// attached to ctx.
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok
+}
+
+func withIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// ContextWithIdentity returns a copy of ctx carrying identity, recoverable
+// via IdentityFromContext. An Authenticator uses it to record the identity
+// it established, replacing any mTLS CommonName already on ctx.
+func ContextWithIdentity(ctx context.Context, identity string) context.Context {
+	return withIdentity(ctx, identity)
+}
+
+// attachIdentity records identity on node's Attributes under
+// IdentityAttribute, so that downstream spanreceiver.SpanReceivers can
+// enforce per-tenant policy.
+func attachIdentity(node *commonpb.Node, identity string) {
+	if node.Attributes == nil {
+		node.Attributes = make(map[string]string)
+	}
+	node.Attributes[IdentityAttribute] = identity
+}
+
+// BearerTokenFromContext extracts the bearer token from the "authorization"
+// gRPC metadata on ctx, if present. It is a convenience for Authenticator
+// implementations that authenticate via a bearer token.
+func BearerTokenFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, v := range md.Get("authorization") {
+		const prefix = "Bearer "
+		if len(v) > len(prefix) && v[:len(prefix)] == prefix {
+			return v[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// GRPCServerOptions returns the grpc.ServerOptions needed to apply
+// whatever transport security and authentication were configured on oci
+// via WithTLSConfig and WithAuthenticator, for both the streaming Export
+// RPC oci itself serves and any unary RPCs (for example the OTLP
+// interceptor's Export) registered alongside it on the same server.
+// Callers building a gRPC server that multiplexes oci with other services
+// (see the agent package) should pass these through to grpc.NewServer
+// alongside their own options.
+func (oci *OCInterceptor) GRPCServerOptions() []grpc.ServerOption {
+	var serverOpts []grpc.ServerOption
+	if oci.tlsConfig != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(oci.tlsConfig)))
+	}
+	serverOpts = append(serverOpts,
+		grpc.StreamInterceptor(oci.authStreamInterceptor()),
+		grpc.UnaryInterceptor(oci.authUnaryInterceptor()),
+	)
+	return serverOpts
+}
+
+// NewGRPCServer builds a *grpc.Server with oci's TraceServiceServer
+// registered, applying whatever transport security and authentication were
+// configured on oci via WithTLSConfig and WithAuthenticator.
+func NewGRPCServer(oci *OCInterceptor) (*grpc.Server, error) {
+	srv := grpc.NewServer(oci.GRPCServerOptions()...)
+	agenttracepb.RegisterTraceServiceServer(srv, oci)
+	return srv, nil
+}
+
+// authenticate runs the shared mTLS/Authenticator logic used by both the
+// streaming and unary interceptors, returning a context with whatever
+// identity was established.
+func (oci *OCInterceptor) authenticate(ctx context.Context) (context.Context, error) {
+	if cn, ok := clientCertCommonName(ctx); ok {
+		ctx = withIdentity(ctx, cn)
+	}
+
+	if oci.authenticator != nil {
+		authedCtx, err := oci.authenticator(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "ocinterceptor: authentication failed: %v", err)
+		}
+		ctx = authedCtx
+	}
+
+	return ctx, nil
+}
+
+func (oci *OCInterceptor) authStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := oci.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextualServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authUnaryInterceptor applies the same authentication as
+// authStreamInterceptor to unary RPCs registered on the same gRPC server
+// (for example the OTLP interceptor's Export), so that multiplexing a
+// streaming and a unary service behind one OCInterceptor doesn't leave the
+// unary side unauthenticated.
+func (oci *OCInterceptor) authUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := oci.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func clientCertCommonName(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return "", false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return tlsInfo.State.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// contextualServerStream overrides grpc.ServerStream.Context so that the
+// identity attached during authentication is visible to the RPC handler.
+type contextualServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextualServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,106 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocinterceptor_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/census-instrumentation/opencensus-service/interceptor/opencensus"
+)
+
+const wantToken = "s3cr3t"
+
+func TestOCInterceptor_authenticatedExport(t *testing.T) {
+	sappender := newSpanAppender()
+	oci, err := ocinterceptor.New(sappender,
+		ocinterceptor.WithSpanBufferPeriod(50*time.Millisecond),
+		ocinterceptor.WithAuthenticator(func(ctx context.Context) (context.Context, error) {
+			token, ok := ocinterceptor.BearerTokenFromContext(ctx)
+			if !ok || token != wantToken {
+				return ctx, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+			}
+			return ctx, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the OCInterceptor: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find an available address to run the gRPC server: %v", err)
+	}
+	defer ln.Close()
+
+	srv, err := ocinterceptor.NewGRPCServer(oci)
+	if err != nil {
+		t.Fatalf("Failed to build the gRPC server: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Stop()
+
+	cc, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Failed to create the gRPC client connection: %v", err)
+	}
+	defer cc.Close()
+
+	svc := agenttracepb.NewTraceServiceClient(cc)
+
+	// Unauthenticated: no bearer token.
+	unauthedClient, err := svc.Export(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open the unauthenticated Export stream: %v", err)
+	}
+	if err := unauthedClient.Send(&agenttracepb.ExportTraceServiceRequest{Node: &commonpb.Node{}}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, err := unauthedClient.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for a stream without a bearer token, got: %v", err)
+	}
+
+	// Happy path: valid bearer token.
+	authedCtx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+wantToken)
+	authedClient, err := svc.Export(authedCtx)
+	if err != nil {
+		t.Fatalf("Failed to open the authenticated Export stream: %v", err)
+	}
+
+	node := &commonpb.Node{Identifier: &commonpb.ProcessIdentifier{Pid: 1, HostName: "authed-host"}}
+	if err := authedClient.Send(&agenttracepb.ExportTraceServiceRequest{Node: node, Spans: []*tracepb.Span{{TraceId: []byte("1234567890abcde")}}}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	<-time.After(150 * time.Millisecond)
+
+	var gotNode *commonpb.Node
+	sappender.forEachEntry(func(n *commonpb.Node, _ []*tracepb.Span) {
+		gotNode = n
+	})
+	if gotNode == nil {
+		t.Fatal("No spans were received through the authenticated stream")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocinterceptor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// SessionHeader is the HTTP header a client uses to scope an HTTPInterceptor
+// POST to a session: POSTing a Node against a session once lets later POSTs
+// for the same session omit the Node, the same way the gRPC Export stream
+// lets a Node-less message fall back to the last one seen.
+const SessionHeader = "X-OpenCensus-Session-Id"
+
+// HTTPInterceptor accepts POSTed ExportTraceServiceRequest payloads over
+// HTTP, as either "application/x-protobuf" or "application/json", and
+// feeds them through the same bundler/receiver pipeline as an
+// OCInterceptor's gRPC Export, so that browser and sidecar clients that
+// cannot open a gRPC stream can still deliver spans.
+type HTTPInterceptor struct {
+	oci *OCInterceptor
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*commonpb.Node
+}
+
+// NewHTTPInterceptor creates a new HTTPInterceptor that feeds spans into
+// the same pipeline as oci.
+func NewHTTPInterceptor(oci *OCInterceptor) *HTTPInterceptor {
+	return &HTTPInterceptor{
+		oci:      oci,
+		sessions: make(map[string]*commonpb.Node),
+	}
+}
+
+var _ http.Handler = (*HTTPInterceptor)(nil)
+
+// ServeHTTP implements http.Handler. A request's Node is resolved against
+// its SessionHeader the same way a gRPC stream resolves a Node-less
+// message against the last Node it saw: if the request carries a Node, it
+// is both used and remembered for the session; otherwise the session's
+// last-remembered Node is used.
+func (hi *HTTPInterceptor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := decodeExportTraceServiceRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	node := hi.resolveNode(r.Header.Get(SessionHeader), req.Node)
+	if len(req.Spans) > 0 {
+		hi.oci.addSpans(node, req.Spans)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (hi *HTTPInterceptor) resolveNode(sessionID string, node *commonpb.Node) *commonpb.Node {
+	if sessionID == "" {
+		return node
+	}
+
+	hi.sessionsMu.Lock()
+	defer hi.sessionsMu.Unlock()
+
+	if node != nil {
+		hi.sessions[sessionID] = node
+		return node
+	}
+	return hi.sessions[sessionID]
+}
+
+func decodeExportTraceServiceRequest(r *http.Request) (*agenttracepb.ExportTraceServiceRequest, error) {
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req := new(agenttracepb.ExportTraceServiceRequest)
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		// No (or unparseable) Content-Type: fall back to the protobuf wire
+		// format, the same default net/http itself assumes.
+		mediaType = "application/x-protobuf"
+	}
+	if mediaType == "application/json" {
+		err = jsonpb.Unmarshal(bytes.NewReader(body), req)
+	} else {
+		err = proto.Unmarshal(body, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
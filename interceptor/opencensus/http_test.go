@@ -0,0 +1,144 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocinterceptor_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/census-instrumentation/opencensus-service/interceptor/opencensus"
+)
+
+// The HTTP path should honor the same session-scoped last-node fallback
+// that TestExportMultiplexing locks in for the gRPC stream: a Node posted
+// once is remembered for the session and reused by later Node-less posts.
+func TestHTTPInterceptor_sessionMultiplexing(t *testing.T) {
+	sappender := newSpanAppender()
+	oci, err := ocinterceptor.New(sappender, ocinterceptor.WithSpanBufferPeriod(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create the OCInterceptor: %v", err)
+	}
+	hi := ocinterceptor.NewHTTPInterceptor(oci)
+	srv := httptest.NewServer(hi)
+	defer srv.Close()
+
+	const sessionID = "session-1"
+	node := &commonpb.Node{Identifier: &commonpb.ProcessIdentifier{Pid: 1, HostName: "browser-host"}}
+
+	post(t, srv.URL, sessionID, "application/x-protobuf", mustMarshalProto(t, &agenttracepb.ExportTraceServiceRequest{
+		Node:  node,
+		Spans: []*tracepb.Span{{TraceId: []byte("1234567890abcde")}},
+	}))
+
+	post(t, srv.URL, sessionID, "application/json", mustMarshalJSON(t, &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{TraceId: []byte("abcdefghijklmno")}},
+	}))
+
+	<-time.After(150 * time.Millisecond)
+
+	resultsMapping := make(map[string][]*tracepb.Span)
+	sappender.forEachEntry(func(n *commonpb.Node, spans []*tracepb.Span) {
+		resultsMapping[nodeToKey(n)] = append(resultsMapping[nodeToKey(n)], spans...)
+	})
+
+	// Both posts should have been attributed to the single Node carried by
+	// the first one: exactly one key in the results map.
+	if g, w := len(resultsMapping), 1; g != w {
+		t.Fatalf("Got %d keys in the results map; Wanted exactly %d\n\nResultsMapping: %+v\n", g, w, resultsMapping)
+	}
+	if g, w := len(resultsMapping[nodeToKey(node)]), 2; g != w {
+		t.Errorf("SpanCount: got %d want %d", g, w)
+	}
+}
+
+// A Content-Type header carrying parameters (e.g. the charset a browser's
+// fetch() adds by default) must still be recognized as JSON rather than
+// falling through to the protobuf-wire-format branch.
+func TestHTTPInterceptor_jsonContentTypeWithParameters(t *testing.T) {
+	sappender := newSpanAppender()
+	oci, err := ocinterceptor.New(sappender, ocinterceptor.WithSpanBufferPeriod(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create the OCInterceptor: %v", err)
+	}
+	hi := ocinterceptor.NewHTTPInterceptor(oci)
+	srv := httptest.NewServer(hi)
+	defer srv.Close()
+
+	node := &commonpb.Node{Identifier: &commonpb.ProcessIdentifier{Pid: 1, HostName: "browser-host"}}
+	post(t, srv.URL, "session-2", "application/json; charset=utf-8", mustMarshalJSON(t, &agenttracepb.ExportTraceServiceRequest{
+		Node:  node,
+		Spans: []*tracepb.Span{{TraceId: []byte("1234567890abcde")}},
+	}))
+
+	<-time.After(150 * time.Millisecond)
+
+	resultsMapping := make(map[string][]*tracepb.Span)
+	sappender.forEachEntry(func(n *commonpb.Node, spans []*tracepb.Span) {
+		resultsMapping[nodeToKey(n)] = append(resultsMapping[nodeToKey(n)], spans...)
+	})
+
+	if g, w := len(resultsMapping[nodeToKey(node)]), 1; g != w {
+		t.Errorf("SpanCount: got %d want %d\n\nResultsMapping: %+v\n", g, w, resultsMapping)
+	}
+}
+
+func post(t *testing.T, url, sessionID, contentType string, body []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(ocinterceptor.SessionHeader, sessionID)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to POST: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+func mustMarshalProto(t *testing.T, req *agenttracepb.ExportTraceServiceRequest) []byte {
+	t.Helper()
+	blob, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	return blob
+}
+
+func mustMarshalJSON(t *testing.T, req *agenttracepb.ExportTraceServiceRequest) []byte {
+	t.Helper()
+	marshaler := jsonpb.Marshaler{}
+	var sb strings.Builder
+	if err := marshaler.Marshal(&sb, req); err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	return []byte(sb.String())
+}
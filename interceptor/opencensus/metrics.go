@@ -0,0 +1,147 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocinterceptor
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/api/support/bundler"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+
+	"github.com/census-instrumentation/opencensus-service/metricsreceiver"
+)
+
+const (
+	defaultMetricsBufferPeriod = 2 * time.Second
+	defaultMetricsBufferCount  = 50
+)
+
+var errNilMetricsReceiver = errors.New("ocinterceptor: nil metricsreceiver.MetricsReceiver")
+
+// MetricsInterceptor receives metrics from OpenCensus agent/exporter
+// clients and forwards them to a metricsreceiver.MetricsReceiver. It
+// implements the MetricsService_ExportServer streaming RPC, with the same
+// "initiating node then pass-through" multiplexing behavior as
+// OCInterceptor.
+type MetricsInterceptor struct {
+	metricsReceiver     metricsreceiver.MetricsReceiver
+	metricsBufferPeriod time.Duration
+	metricsBufferCount  int
+
+	bundlersMu sync.Mutex
+	bundlers   map[*commonpb.Node]*bundler.Bundler
+}
+
+// MetricsOption apply changes to MetricsInterceptor.
+type MetricsOption func(*MetricsInterceptor)
+
+// WithMetricsBufferPeriod overrides the default period after which a
+// node's buffered metrics are flushed to the metricsreceiver.MetricsReceiver.
+func WithMetricsBufferPeriod(period time.Duration) MetricsOption {
+	return func(mi *MetricsInterceptor) {
+		mi.metricsBufferPeriod = period
+	}
+}
+
+// WithMetricsBufferCount overrides the default number of metrics that can
+// be buffered for a node before they are flushed, even if
+// metricsBufferPeriod hasn't yet elapsed.
+func WithMetricsBufferCount(count int) MetricsOption {
+	return func(mi *MetricsInterceptor) {
+		mi.metricsBufferCount = count
+	}
+}
+
+// NewMetricsInterceptor creates a new MetricsInterceptor that forwards
+// received metrics to mr.
+func NewMetricsInterceptor(mr metricsreceiver.MetricsReceiver, opts ...MetricsOption) (*MetricsInterceptor, error) {
+	if mr == nil {
+		return nil, errNilMetricsReceiver
+	}
+
+	mi := &MetricsInterceptor{
+		metricsReceiver:     mr,
+		metricsBufferPeriod: defaultMetricsBufferPeriod,
+		metricsBufferCount:  defaultMetricsBufferCount,
+		bundlers:            make(map[*commonpb.Node]*bundler.Bundler),
+	}
+	for _, opt := range opts {
+		opt(mi)
+	}
+	return mi, nil
+}
+
+var _ agentmetricspb.MetricsServiceServer = (*MetricsInterceptor)(nil)
+
+// Export implements the MetricsService_ExportServer streaming RPC. The
+// first message on the stream must carry a non-nil Node; subsequent
+// messages that omit a Node are attributed to the last Node seen on this
+// stream.
+func (mi *MetricsInterceptor) Export(mes agentmetricspb.MetricsService_ExportServer) error {
+	var lastNonNilNode *commonpb.Node
+
+	for {
+		recv, err := mes.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if recv.Node != nil {
+			lastNonNilNode = recv.Node
+		}
+
+		if len(recv.Metrics) == 0 {
+			continue
+		}
+
+		mi.addMetrics(lastNonNilNode, recv.Metrics)
+	}
+}
+
+func (mi *MetricsInterceptor) addMetrics(node *commonpb.Node, metrics []*metricspb.Metric) {
+	b := mi.bundlerForNode(node)
+	for _, metric := range metrics {
+		// The bundler only errs when the item is larger than the configured
+		// bundle byte limit, which a single metric never is.
+		_ = b.Add(metric, 1)
+	}
+}
+
+func (mi *MetricsInterceptor) bundlerForNode(node *commonpb.Node) *bundler.Bundler {
+	mi.bundlersMu.Lock()
+	defer mi.bundlersMu.Unlock()
+
+	if b, ok := mi.bundlers[node]; ok {
+		return b
+	}
+
+	b := bundler.NewBundler((*metricspb.Metric)(nil), func(payload interface{}) {
+		metrics := payload.([]*metricspb.Metric)
+		_, _ = mi.metricsReceiver.ReceiveMetrics(node, metrics...)
+	})
+	b.DelayThreshold = mi.metricsBufferPeriod
+	b.BundleCountThreshold = mi.metricsBufferCount
+	mi.bundlers[node] = b
+	return b
+}
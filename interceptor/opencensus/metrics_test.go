@@ -0,0 +1,146 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocinterceptor_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	"github.com/census-instrumentation/opencensus-service/interceptor/opencensus"
+	"github.com/census-instrumentation/opencensus-service/metricsreceiver"
+)
+
+// Issue #43's metrics analogue. MetricsInterceptor must support the same
+// node multiplexing behavior as OCInterceptor's Export: the first message
+// carries the initiating node, and messages without a node are attributed
+// to the last non-nil node seen on the stream.
+func TestMetricsExportMultiplexing(t *testing.T) {
+	metricsSink := newMetricsAppender()
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find an available address to run the gRPC server: %v", err)
+	}
+	defer ln.Close()
+
+	mi, err := ocinterceptor.NewMetricsInterceptor(metricsSink, ocinterceptor.WithMetricsBufferPeriod(90*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create the MetricsInterceptor: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	agentmetricspb.RegisterMetricsServiceServer(srv, mi)
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Stop()
+
+	cc, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Failed to create the gRPC client connection: %v", err)
+	}
+	defer cc.Close()
+
+	svc := agentmetricspb.NewMetricsServiceClient(cc)
+	metricsClient, err := svc.Export(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create the metricsClient: %v", err)
+	}
+
+	initiatingNode := &commonpb.Node{
+		Identifier: &commonpb.ProcessIdentifier{Pid: 1, HostName: "multiplexer"},
+	}
+	if err := metricsClient.Send(&agentmetricspb.ExportMetricsServiceRequest{Node: initiatingNode}); err != nil {
+		t.Fatalf("Failed to send the initiating message: %v", err)
+	}
+
+	mLi := []*metricspb.Metric{{MetricDescriptor: &metricspb.MetricDescriptor{Name: "m0"}}}
+	if err := metricsClient.Send(&agentmetricspb.ExportMetricsServiceRequest{Node: nil, Metrics: mLi}); err != nil {
+		t.Fatalf("Failed to send the passthrough message: %v", err)
+	}
+
+	node1 := &commonpb.Node{Identifier: &commonpb.ProcessIdentifier{Pid: 9489, HostName: "nodejs-host"}}
+	mL1 := []*metricspb.Metric{{MetricDescriptor: &metricspb.MetricDescriptor{Name: "m1"}}}
+	if err := metricsClient.Send(&agentmetricspb.ExportMetricsServiceRequest{Node: node1, Metrics: mL1}); err != nil {
+		t.Fatalf("Failed to send the proxied message from app1: %v", err)
+	}
+
+	mLn1 := []*metricspb.Metric{{MetricDescriptor: &metricspb.MetricDescriptor{Name: "m2"}}}
+	if err := metricsClient.Send(&agentmetricspb.ExportMetricsServiceRequest{Node: nil, Metrics: mLn1}); err != nil {
+		t.Fatalf("Failed to send the proxied message without a node: %v", err)
+	}
+
+	<-time.After(150 * time.Millisecond)
+
+	resultsMapping := make(map[string][]*metricspb.Metric)
+	metricsSink.forEachEntry(func(node *commonpb.Node, metrics []*metricspb.Metric) {
+		resultsMapping[metricsNodeToKey(node)] = metrics
+	})
+
+	if g, w := len(resultsMapping), 2; g != w {
+		t.Errorf("Got %d keys in the results map; Wanted exactly %d\n\nResultsMapping: %+v\n", g, w, resultsMapping)
+	}
+
+	wantMetricCounts := map[string]int{
+		metricsNodeToKey(initiatingNode): 1,
+		metricsNodeToKey(node1):          2,
+	}
+	for key, want := range wantMetricCounts {
+		if got := len(resultsMapping[key]); got != want {
+			t.Errorf("Key=%q gotMetricCounts %d wantMetricCounts %d", key, got, want)
+		}
+	}
+}
+
+func metricsNodeToKey(n *commonpb.Node) string {
+	blob, _ := proto.Marshal(n)
+	return string(blob)
+}
+
+type metricsAppender struct {
+	sync.RWMutex
+	metricsPerNode map[*commonpb.Node][]*metricspb.Metric
+}
+
+func newMetricsAppender() *metricsAppender {
+	return &metricsAppender{metricsPerNode: make(map[*commonpb.Node][]*metricspb.Metric)}
+}
+
+var _ metricsreceiver.MetricsReceiver = (*metricsAppender)(nil)
+
+func (ma *metricsAppender) ReceiveMetrics(node *commonpb.Node, metrics ...*metricspb.Metric) (*metricsreceiver.Acknowledgement, error) {
+	ma.Lock()
+	defer ma.Unlock()
+
+	ma.metricsPerNode[node] = append(ma.metricsPerNode[node], metrics...)
+
+	return &metricsreceiver.Acknowledgement{SavedMetrics: uint64(len(metrics))}, nil
+}
+
+func (ma *metricsAppender) forEachEntry(fn func(*commonpb.Node, []*metricspb.Metric)) {
+	ma.RLock()
+	defer ma.RUnlock()
+
+	for node, metrics := range ma.metricsPerNode {
+		fn(node, metrics)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocinterceptor_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/census-instrumentation/opencensus-service/interceptor/opencensus"
+)
+
+// TestOCInterceptor_mTLS exercises WithTLSConfig end to end: a client
+// presenting a certificate signed by the configured CA is let through and
+// has its certificate's CommonName recorded as the Node's identity, while a
+// client that can't complete the mTLS handshake (no client cert) is
+// rejected before ever reaching the interceptor.
+func TestOCInterceptor_mTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, "oc-agent")
+	clientCert := ca.issue(t, "test-client")
+
+	sappender := newSpanAppender()
+	oci, err := ocinterceptor.New(sappender,
+		ocinterceptor.WithSpanBufferPeriod(50*time.Millisecond),
+		ocinterceptor.WithTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientCAs:    ca.pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the OCInterceptor: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find an available address to run the gRPC server: %v", err)
+	}
+	defer ln.Close()
+
+	srv, err := ocinterceptor.NewGRPCServer(oci)
+	if err != nil {
+		t.Fatalf("Failed to build the gRPC server: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Stop()
+
+	// Rejected: a client with no certificate can't complete the mTLS
+	// handshake at all.
+	insecureClientTLS := &tls.Config{RootCAs: ca.pool, ServerName: "oc-agent"}
+	insecureCC, err := grpc.Dial(ln.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(insecureClientTLS)))
+	if err != nil {
+		t.Fatalf("Failed to create the gRPC client connection: %v", err)
+	}
+	defer insecureCC.Close()
+
+	unauthedClient := agenttracepb.NewTraceServiceClient(insecureCC)
+	stream, err := unauthedClient.Export(context.Background())
+	if err == nil {
+		if err = stream.Send(&agenttracepb.ExportTraceServiceRequest{Node: &commonpb.Node{}}); err == nil {
+			_, err = stream.Recv()
+		}
+	}
+	if err == nil {
+		t.Error("Expected a client without a certificate to be rejected by the mTLS handshake")
+	}
+
+	// Happy path: a client with a CA-signed certificate gets through, and
+	// its certificate's CommonName is attached to the Node.
+	clientTLS := &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      ca.pool,
+		ServerName:   "oc-agent",
+	}
+	cc, err := grpc.Dial(ln.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Failed to create the authenticated gRPC client connection: %v", err)
+	}
+	defer cc.Close()
+
+	svc := agenttracepb.NewTraceServiceClient(cc)
+	authedClient, err := svc.Export(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create the traceClient: %v", err)
+	}
+
+	node := &commonpb.Node{Identifier: &commonpb.ProcessIdentifier{Pid: 1, HostName: "mtls-host"}}
+	if err := authedClient.Send(&agenttracepb.ExportTraceServiceRequest{Node: node, Spans: []*tracepb.Span{{TraceId: []byte("1234567890abcde")}}}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	<-time.After(150 * time.Millisecond)
+
+	var gotNode *commonpb.Node
+	sappender.forEachEntry(func(n *commonpb.Node, _ []*tracepb.Span) {
+		gotNode = n
+	})
+	if gotNode == nil {
+		t.Fatal("No spans were received through the mTLS-authenticated stream")
+	}
+	if got, want := gotNode.Attributes[ocinterceptor.IdentityAttribute], "test-client"; got != want {
+		t.Errorf("Node identity: got %q want %q", got, want)
+	}
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse CA certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key for %q: %v", commonName, err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{commonName},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate for %q: %v", commonName, err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ocinterceptor implements an interceptor that receives spans from
+// OpenCensus agent/exporter clients speaking the TraceService gRPC
+// streaming protocol, and forwards them to a spanreceiver.SpanReceiver.
+package ocinterceptor
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/api/support/bundler"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+
+	"github.com/census-instrumentation/opencensus-service/spanreceiver"
+	"github.com/census-instrumentation/opencensus-service/tailsampling"
+)
+
+const (
+	defaultSpanBufferPeriod = 2 * time.Second
+	defaultSpanBufferCount  = 50
+)
+
+var errNilSpanReceiver = errors.New("ocinterceptor: nil spanreceiver.SpanReceiver")
+
+// OCInterceptor receives spans from OpenCensus agent/exporter clients and
+// forwards them to a spanreceiver.SpanReceiver. It implements the
+// TraceService_ExportServer streaming RPC.
+type OCInterceptor struct {
+	spanReceiver     spanreceiver.SpanReceiver
+	spanBufferPeriod time.Duration
+	spanBufferCount  int
+	samplingPolicy   tailsampling.Policy
+	tlsConfig        *tls.Config
+	authenticator    Authenticator
+
+	// sampler is non-nil when WithSamplingPolicy wrapped spanReceiver in a
+	// tailsampling.Processor, so Close can stop its sweep goroutine.
+	sampler *tailsampling.Processor
+
+	bundlersMu sync.Mutex
+	bundlers   map[*commonpb.Node]*bundler.Bundler
+}
+
+// OCOption apply changes to OCInterceptor.
+type OCOption func(*OCInterceptor)
+
+// WithSpanBufferPeriod overrides the default period after which a node's
+// buffered spans are flushed to the spanreceiver.SpanReceiver.
+func WithSpanBufferPeriod(period time.Duration) OCOption {
+	return func(oci *OCInterceptor) {
+		oci.spanBufferPeriod = period
+	}
+}
+
+// WithSpanBufferCount overrides the default number of spans that can be
+// buffered for a node before they are flushed, even if spanBufferPeriod
+// hasn't yet elapsed.
+func WithSpanBufferCount(count int) OCOption {
+	return func(oci *OCInterceptor) {
+		oci.spanBufferCount = count
+	}
+}
+
+// WithSamplingPolicy inserts a tail-based sampling stage between the
+// interceptor and its downstream spanreceiver.SpanReceiver: spans are
+// grouped by trace, held for a bounded decision window, and only forwarded
+// downstream if policy samples the completed trace.
+func WithSamplingPolicy(policy tailsampling.Policy) OCOption {
+	return func(oci *OCInterceptor) {
+		oci.samplingPolicy = policy
+	}
+}
+
+// New creates a new OCInterceptor that forwards received spans to sr.
+func New(sr spanreceiver.SpanReceiver, opts ...OCOption) (*OCInterceptor, error) {
+	if sr == nil {
+		return nil, errNilSpanReceiver
+	}
+
+	oci := &OCInterceptor{
+		spanReceiver:     sr,
+		spanBufferPeriod: defaultSpanBufferPeriod,
+		spanBufferCount:  defaultSpanBufferCount,
+		bundlers:         make(map[*commonpb.Node]*bundler.Bundler),
+	}
+	for _, opt := range opts {
+		opt(oci)
+	}
+
+	if oci.samplingPolicy != nil {
+		oci.sampler = tailsampling.NewProcessor(oci.spanReceiver, oci.samplingPolicy)
+		oci.spanReceiver = oci.sampler
+	}
+
+	return oci, nil
+}
+
+var _ agenttracepb.TraceServiceServer = (*OCInterceptor)(nil)
+
+// SpanReceiver returns the spanreceiver.SpanReceiver spans are ultimately
+// forwarded to, which is oci's downstream tailsampling.Processor when
+// WithSamplingPolicy was used, or the SpanReceiver passed to New otherwise.
+// Other interceptors that need to share OCInterceptor's pipeline (for
+// example the OTLP interceptor registered alongside it) should forward
+// into this rather than the original SpanReceiver.
+func (oci *OCInterceptor) SpanReceiver() spanreceiver.SpanReceiver {
+	return oci.spanReceiver
+}
+
+// Close releases resources started on oci's behalf, such as the
+// tailsampling.Processor's sweep goroutine when WithSamplingPolicy was
+// used. Callers that recreate an OCInterceptor (for example on a config
+// reload) should Close the old one first.
+func (oci *OCInterceptor) Close() error {
+	if oci.sampler != nil {
+		return oci.sampler.Close()
+	}
+	return nil
+}
+
+// Export implements the TraceService_ExportServer streaming RPC. The first
+// message on the stream must carry a non-nil Node; subsequent messages that
+// omit a Node are attributed to the last Node seen on this stream.
+func (oci *OCInterceptor) Export(tes agenttracepb.TraceService_ExportServer) error {
+	var lastNonNilNode *commonpb.Node
+	identity, hasIdentity := IdentityFromContext(tes.Context())
+
+	for {
+		recv, err := tes.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if recv.Node != nil {
+			lastNonNilNode = recv.Node
+			if hasIdentity {
+				attachIdentity(lastNonNilNode, identity)
+			}
+		}
+
+		if len(recv.Spans) == 0 {
+			continue
+		}
+
+		oci.addSpans(lastNonNilNode, recv.Spans)
+	}
+}
+
+// Config implements the TraceServiceServer interface's remote-config RPC.
+// OCInterceptor doesn't support pushing config to agents, so, matching
+// upstream convention, it just rejects the stream as unimplemented.
+func (oci *OCInterceptor) Config(agenttracepb.TraceService_ConfigServer) error {
+	return status.Error(codes.Unimplemented, "ocinterceptor: Config is not implemented")
+}
+
+func (oci *OCInterceptor) addSpans(node *commonpb.Node, spans []*tracepb.Span) {
+	b := oci.bundlerForNode(node)
+	for _, span := range spans {
+		// The bundler only errs when the item is larger than the configured
+		// bundle byte limit, which a single span never is.
+		_ = b.Add(span, 1)
+	}
+}
+
+func (oci *OCInterceptor) bundlerForNode(node *commonpb.Node) *bundler.Bundler {
+	oci.bundlersMu.Lock()
+	defer oci.bundlersMu.Unlock()
+
+	if b, ok := oci.bundlers[node]; ok {
+		return b
+	}
+
+	b := bundler.NewBundler((*tracepb.Span)(nil), func(payload interface{}) {
+		spans := payload.([]*tracepb.Span)
+		_, _ = oci.spanReceiver.ReceiveSpans(node, spans...)
+	})
+	b.DelayThreshold = oci.spanBufferPeriod
+	b.BundleCountThreshold = oci.spanBufferCount
+	oci.bundlers[node] = b
+	return b
+}
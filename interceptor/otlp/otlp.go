@@ -0,0 +1,262 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlpinterceptor implements an interceptor that receives spans
+// over the OpenTelemetry Protocol's unary TraceService/Export RPC and
+// forwards them to a spanreceiver.SpanReceiver, translating OTLP's
+// ResourceSpans/ScopeSpans shape into the commonpb.Node/tracepb.Span shape
+// the rest of the pipeline speaks. It is the OTLP sibling of
+// ocinterceptor.OCInterceptor.
+package otlpinterceptor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+
+	otlpcollectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpcommonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"github.com/census-instrumentation/opencensus-service/interceptor/opencensus"
+	"github.com/census-instrumentation/opencensus-service/spanreceiver"
+)
+
+var errNilSpanReceiver = errors.New("otlpinterceptor: nil spanreceiver.SpanReceiver")
+
+// OTLPInterceptor receives spans over the OpenTelemetry Protocol's unary
+// TraceService/Export RPC and forwards them to a spanreceiver.SpanReceiver.
+type OTLPInterceptor struct {
+	// UnimplementedTraceServiceServer satisfies the forward-compatibility
+	// requirement of otlpcollectortracepb.TraceServiceServer; OTLPInterceptor
+	// only needs to implement Export.
+	otlpcollectortracepb.UnimplementedTraceServiceServer
+
+	spanReceiver spanreceiver.SpanReceiver
+}
+
+var _ otlpcollectortracepb.TraceServiceServer = (*OTLPInterceptor)(nil)
+
+// New creates a new OTLPInterceptor that forwards received spans to sr.
+func New(sr spanreceiver.SpanReceiver) (*OTLPInterceptor, error) {
+	if sr == nil {
+		return nil, errNilSpanReceiver
+	}
+	return &OTLPInterceptor{spanReceiver: sr}, nil
+}
+
+// Export implements the OTLP TraceService/Export unary RPC. Unlike the OC
+// streaming RPC there is no "last seen node" to fall back on: every
+// ResourceSpans/ScopeSpans pair carries its own Resource and
+// InstrumentationScope, which are translated into a commonpb.Node per call
+// to the spanreceiver.SpanReceiver.
+func (oi *OTLPInterceptor) Export(ctx context.Context, req *otlpcollectortracepb.ExportTraceServiceRequest) (*otlpcollectortracepb.ExportTraceServiceResponse, error) {
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			spans := scopeSpansToOCSpans(ss)
+			if len(spans) == 0 {
+				continue
+			}
+
+			node := resourceAndScopeToNode(rs.Resource, ss.Scope)
+			if identity, ok := ocinterceptor.IdentityFromContext(ctx); ok {
+				node.Attributes[ocinterceptor.IdentityAttribute] = identity
+			}
+			if _, err := oi.spanReceiver.ReceiveSpans(node, spans...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &otlpcollectortracepb.ExportTraceServiceResponse{}, nil
+}
+
+func resourceAndScopeToNode(resource *otlpresourcepb.Resource, scope *otlpcommonpb.InstrumentationScope) *commonpb.Node {
+	node := &commonpb.Node{
+		Identifier:  &commonpb.ProcessIdentifier{},
+		LibraryInfo: &commonpb.LibraryInfo{},
+		Attributes:  make(map[string]string),
+	}
+
+	if scope != nil {
+		node.LibraryInfo.ExporterVersion = scope.Version
+		if scope.Name != "" {
+			node.Attributes["otlp.scope.name"] = scope.Name
+		}
+	}
+
+	for _, kv := range resource.GetAttributes() {
+		switch kv.Key {
+		case "host.name":
+			node.Identifier.HostName = kv.Value.GetStringValue()
+		case "service.name":
+			node.ServiceInfo = &commonpb.ServiceInfo{Name: kv.Value.GetStringValue()}
+		case "process.pid":
+			node.Identifier.Pid = uint32(kv.Value.GetIntValue())
+		default:
+			node.Attributes[kv.Key] = attributeValueToString(kv.Value)
+		}
+	}
+
+	return node
+}
+
+func scopeSpansToOCSpans(ss *otlptracepb.ScopeSpans) []*tracepb.Span {
+	spans := make([]*tracepb.Span, 0, len(ss.Spans))
+	for _, s := range ss.Spans {
+		spans = append(spans, otlpSpanToOCSpan(s))
+	}
+	return spans
+}
+
+func otlpSpanToOCSpan(s *otlptracepb.Span) *tracepb.Span {
+	ocSpan := &tracepb.Span{
+		TraceId:      s.TraceId,
+		SpanId:       s.SpanId,
+		ParentSpanId: s.ParentSpanId,
+		Name:         &tracepb.TruncatableString{Value: s.Name},
+		Kind:         otlpSpanKindToOCKind(s.Kind),
+		StartTime:    unixNanoToTimestamp(s.StartTimeUnixNano),
+		EndTime:      unixNanoToTimestamp(s.EndTimeUnixNano),
+		Status:       otlpStatusToOCStatus(s.Status),
+		Attributes:   otlpAttributesToOCAttributes(s.Attributes),
+	}
+
+	if events := otlpEventsToOCTimeEvents(s.Events); events != nil {
+		ocSpan.TimeEvents = events
+	}
+	if links := otlpLinksToOCLinks(s.Links); links != nil {
+		ocSpan.Links = links
+	}
+
+	return ocSpan
+}
+
+func otlpSpanKindToOCKind(kind otlptracepb.Span_SpanKind) tracepb.Span_SpanKind {
+	switch kind {
+	case otlptracepb.Span_SPAN_KIND_SERVER:
+		return tracepb.Span_SERVER
+	case otlptracepb.Span_SPAN_KIND_CLIENT:
+		return tracepb.Span_CLIENT
+	default:
+		return tracepb.Span_SPAN_KIND_UNSPECIFIED
+	}
+}
+
+// ocStatusCodeUnknown is google.rpc.Code's UNKNOWN, the generic non-OK code
+// tracepb.Status.Code uses when a more specific one isn't available.
+const ocStatusCodeUnknown = 2
+
+// otlpStatusToOCStatus translates OTLP's own status enum (0=UNSET, 1=OK,
+// 2=ERROR) into OC's Status.Code, which instead follows the
+// google.rpc.Status convention where 0 means OK and anything else is an
+// error. Reusing OTLP's raw enum value would turn an explicitly OK span
+// (OTLP code 1) into a non-OK OC status.
+func otlpStatusToOCStatus(status *otlptracepb.Status) *tracepb.Status {
+	if status == nil {
+		return nil
+	}
+
+	code := int32(0)
+	if status.Code == otlptracepb.Status_STATUS_CODE_ERROR {
+		code = ocStatusCodeUnknown
+	}
+	return &tracepb.Status{
+		Code:    code,
+		Message: status.Message,
+	}
+}
+
+func otlpAttributesToOCAttributes(kvs []*otlpcommonpb.KeyValue) *tracepb.Span_Attributes {
+	if len(kvs) == 0 {
+		return nil
+	}
+
+	attrMap := make(map[string]*tracepb.AttributeValue, len(kvs))
+	for _, kv := range kvs {
+		attrMap[kv.Key] = &tracepb.AttributeValue{
+			Value: &tracepb.AttributeValue_StringValue{
+				StringValue: &tracepb.TruncatableString{Value: attributeValueToString(kv.Value)},
+			},
+		}
+	}
+	return &tracepb.Span_Attributes{AttributeMap: attrMap}
+}
+
+func otlpEventsToOCTimeEvents(events []*otlptracepb.Span_Event) *tracepb.Span_TimeEvents {
+	if len(events) == 0 {
+		return nil
+	}
+
+	timeEvents := make([]*tracepb.Span_TimeEvent, 0, len(events))
+	for _, e := range events {
+		timeEvents = append(timeEvents, &tracepb.Span_TimeEvent{
+			Time: unixNanoToTimestamp(e.TimeUnixNano),
+			Value: &tracepb.Span_TimeEvent_Annotation_{
+				Annotation: &tracepb.Span_TimeEvent_Annotation{
+					Description: &tracepb.TruncatableString{Value: e.Name},
+					Attributes:  otlpAttributesToOCAttributes(e.Attributes),
+				},
+			},
+		})
+	}
+	return &tracepb.Span_TimeEvents{TimeEvent: timeEvents}
+}
+
+func otlpLinksToOCLinks(links []*otlptracepb.Span_Link) *tracepb.Span_Links {
+	if len(links) == 0 {
+		return nil
+	}
+
+	ocLinks := make([]*tracepb.Span_Link, 0, len(links))
+	for _, l := range links {
+		ocLinks = append(ocLinks, &tracepb.Span_Link{
+			TraceId:    l.TraceId,
+			SpanId:     l.SpanId,
+			Type:       tracepb.Span_Link_TYPE_UNSPECIFIED,
+			Attributes: otlpAttributesToOCAttributes(l.Attributes),
+		})
+	}
+	return &tracepb.Span_Links{Link: ocLinks}
+}
+
+func attributeValueToString(v *otlpcommonpb.AnyValue) string {
+	if v == nil {
+		return ""
+	}
+	switch val := v.Value.(type) {
+	case *otlpcommonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *otlpcommonpb.AnyValue_BoolValue:
+		if val.BoolValue {
+			return "true"
+		}
+		return "false"
+	default:
+		return v.String()
+	}
+}
+
+func unixNanoToTimestamp(unixNano uint64) *timestamp.Timestamp {
+	nanos := int64(unixNano)
+	return &timestamp.Timestamp{
+		Seconds: nanos / 1e9,
+		Nanos:   int32(nanos % 1e9),
+	}
+}
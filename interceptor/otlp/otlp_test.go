@@ -0,0 +1,143 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpinterceptor_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/census-instrumentation/opencensus-service/interceptor/otlp"
+	"github.com/census-instrumentation/opencensus-service/spanreceiver"
+
+	otlpcollectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpcommonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestOTLPInterceptor_export(t *testing.T) {
+	sappender := newSpanAppender()
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find an available address to run the gRPC server: %v", err)
+	}
+	defer ln.Close()
+
+	oi, err := otlpinterceptor.New(sappender)
+	if err != nil {
+		t.Fatalf("Failed to create the OTLPInterceptor: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	otlpcollectortracepb.RegisterTraceServiceServer(srv, oi)
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Stop()
+
+	cc, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("Failed to create the gRPC client connection: %v", err)
+	}
+	defer cc.Close()
+
+	client := otlpcollectortracepb.NewTraceServiceClient(cc)
+	req := &otlpcollectortracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptracepb.ResourceSpans{
+			{
+				Resource: &otlpresourcepb.Resource{
+					Attributes: []*otlpcommonpb.KeyValue{
+						{Key: "host.name", Value: &otlpcommonpb.AnyValue{Value: &otlpcommonpb.AnyValue_StringValue{StringValue: "otlp-host"}}},
+						{Key: "service.name", Value: &otlpcommonpb.AnyValue{Value: &otlpcommonpb.AnyValue_StringValue{StringValue: "otlp-service"}}},
+					},
+				},
+				ScopeSpans: []*otlptracepb.ScopeSpans{
+					{
+						Scope: &otlpcommonpb.InstrumentationScope{Name: "test-scope", Version: "v1"},
+						Spans: []*otlptracepb.Span{
+							{
+								TraceId: []byte("1234567890abcdef"),
+								SpanId:  []byte("abcdefgh"),
+								Name:    "otlp-span",
+								Kind:    otlptracepb.Span_SPAN_KIND_SERVER,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if _, err := client.Export(context.Background(), req); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	var gotSpans []*tracepb.Span
+	var gotNode *commonpb.Node
+	sappender.forEachEntry(func(node *commonpb.Node, spans []*tracepb.Span) {
+		gotNode = node
+		gotSpans = append(gotSpans, spans...)
+	})
+
+	if g, w := len(gotSpans), 1; g != w {
+		t.Fatalf("SpanCount: got %d want %d", g, w)
+	}
+	if g, w := gotSpans[0].Name.Value, "otlp-span"; g != w {
+		t.Errorf("SpanName: got %q want %q", g, w)
+	}
+	if g, w := gotSpans[0].Kind, tracepb.Span_SERVER; g != w {
+		t.Errorf("SpanKind: got %v want %v", g, w)
+	}
+	if gotNode == nil || gotNode.Identifier.HostName != "otlp-host" {
+		t.Errorf("Node hostname not translated from the OTLP resource: %+v", gotNode)
+	}
+	if gotNode == nil || gotNode.ServiceInfo.GetName() != "otlp-service" {
+		t.Errorf("Node service name not translated from the OTLP resource: %+v", gotNode)
+	}
+}
+
+type spanAppender struct {
+	sync.RWMutex
+	spansPerNode map[*commonpb.Node][]*tracepb.Span
+}
+
+func newSpanAppender() *spanAppender {
+	return &spanAppender{spansPerNode: make(map[*commonpb.Node][]*tracepb.Span)}
+}
+
+var _ spanreceiver.SpanReceiver = (*spanAppender)(nil)
+
+func (sa *spanAppender) ReceiveSpans(node *commonpb.Node, spans ...*tracepb.Span) (*spanreceiver.Acknowledgement, error) {
+	sa.Lock()
+	defer sa.Unlock()
+
+	sa.spansPerNode[node] = append(sa.spansPerNode[node], spans...)
+
+	return &spanreceiver.Acknowledgement{SavedSpans: uint64(len(spans))}, nil
+}
+
+func (sa *spanAppender) forEachEntry(fn func(*commonpb.Node, []*tracepb.Span)) {
+	sa.RLock()
+	defer sa.RUnlock()
+
+	for node, spans := range sa.spansPerNode {
+		fn(node, spans)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metricsreceiver defines the interface that interceptors use to
+// hand off decoded metrics to the rest of the service. It is the metrics
+// counterpart of spanreceiver.
+package metricsreceiver
+
+import (
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// Acknowledgement is returned by a MetricsReceiver to report how many of the
+// metrics it was handed were accepted.
+type Acknowledgement struct {
+	// SavedMetrics is the number of metrics that were successfully saved.
+	SavedMetrics uint64
+}
+
+// MetricsReceiver is the interface that interceptors use to deliver
+// metrics, attributed to the node that produced them, into the service's
+// pipeline.
+type MetricsReceiver interface {
+	// ReceiveMetrics takes a node and its associated metrics and processes
+	// them. It is the responsibility of the implementation to ensure that
+	// processing is not blocked indefinitely.
+	ReceiveMetrics(node *commonpb.Node, metrics ...*metricspb.Metric) (*Acknowledgement, error)
+}
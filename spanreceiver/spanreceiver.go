@@ -0,0 +1,39 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spanreceiver defines the interface that interceptors use to hand
+// off decoded spans to the rest of the service, regardless of which wire
+// protocol they arrived on.
+package spanreceiver
+
+import (
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// Acknowledgement is returned by a SpanReceiver to report how many of the
+// spans it was handed were accepted.
+type Acknowledgement struct {
+	// SavedSpans is the number of spans that were successfully saved.
+	SavedSpans uint64
+}
+
+// SpanReceiver is the interface that interceptors use to deliver spans,
+// attributed to the node that produced them, into the service's pipeline.
+type SpanReceiver interface {
+	// ReceiveSpans takes a node and its associated spans and processes them.
+	// It is the responsibility of the implementation to ensure that
+	// processing is not blocked indefinitely.
+	ReceiveSpans(node *commonpb.Node, spans ...*tracepb.Span) (*Acknowledgement, error)
+}
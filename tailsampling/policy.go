@@ -0,0 +1,108 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsampling
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// Policy decides, once a trace's decision window has elapsed, whether the
+// accumulated spans of that trace should be forwarded downstream.
+type Policy interface {
+	Sample(node *commonpb.Node, spans []*tracepb.Span) bool
+}
+
+// PolicyFunc adapts a function to a Policy.
+type PolicyFunc func(node *commonpb.Node, spans []*tracepb.Span) bool
+
+// Sample implements Policy.
+func (f PolicyFunc) Sample(node *commonpb.Node, spans []*tracepb.Span) bool {
+	return f(node, spans)
+}
+
+// AlwaysSampleErrors samples a trace if any of its spans carry a non-OK
+// status, regardless of what the next policy in the chain would decide.
+func AlwaysSampleErrors(next Policy) Policy {
+	return PolicyFunc(func(node *commonpb.Node, spans []*tracepb.Span) bool {
+		for _, span := range spans {
+			if span.GetStatus().GetCode() != 0 {
+				return true
+			}
+		}
+		return next.Sample(node, spans)
+	})
+}
+
+// Probabilistic samples a trace with the given probability, in [0, 1].
+func Probabilistic(probability float64) Policy {
+	return PolicyFunc(func(_ *commonpb.Node, _ []*tracepb.Span) bool {
+		return rand.Float64() < probability
+	})
+}
+
+// RateLimitPerService wraps next so that at most maxPerSecond sampled
+// decisions per service, per second, are allowed through. next is consulted
+// first for every trace; a trace next samples is dropped if its service's
+// budget for the current second is already spent. Traces next drops do not
+// count against the budget.
+func RateLimitPerService(maxPerSecond int, next Policy) Policy {
+	rl := &rateLimiter{maxPerSecond: maxPerSecond}
+	return PolicyFunc(func(node *commonpb.Node, spans []*tracepb.Span) bool {
+		if !next.Sample(node, spans) {
+			return false
+		}
+		return rl.allow(node.GetServiceInfo().GetName())
+	})
+}
+
+type rateLimiter struct {
+	maxPerSecond int
+
+	mu        sync.Mutex
+	windowSec int64
+	counts    map[string]int
+}
+
+func (rl *rateLimiter) allow(service string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	nowSec := time.Now().Unix()
+	if nowSec != rl.windowSec {
+		rl.windowSec = nowSec
+		rl.counts = make(map[string]int)
+	}
+	if rl.counts == nil {
+		rl.counts = make(map[string]int)
+	}
+
+	if rl.counts[service] >= rl.maxPerSecond {
+		return false
+	}
+	rl.counts[service]++
+	return true
+}
+
+// NewDefaultPolicy builds the canonical policy chain: always sample traces
+// containing an error, otherwise sample probabilistically, and cap the
+// sampled rate per service.
+func NewDefaultPolicy(sampleProbability float64, maxSampledPerServicePerSecond int) Policy {
+	return AlwaysSampleErrors(RateLimitPerService(maxSampledPerServicePerSecond, Probabilistic(sampleProbability)))
+}
@@ -0,0 +1,309 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tailsampling implements a tail-based sampling stage that can sit
+// between an interceptor and its downstream spanreceiver.SpanReceiver. It
+// groups incoming spans by TraceId in an in-memory, sharded buffer, waits
+// for a bounded decision window, and then applies a Policy to decide
+// whether the accumulated trace should be forwarded downstream.
+package tailsampling
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+
+	"github.com/census-instrumentation/opencensus-service/spanreceiver"
+)
+
+const (
+	defaultDecisionWindow = 10 * time.Second
+	defaultNumShards      = 16
+	maxSweepInterval      = 1 * time.Second
+	minSweepInterval      = time.Millisecond
+)
+
+type traceState int
+
+const (
+	pending traceState = iota
+	decided
+)
+
+// Processor buffers spans by trace, applies a Policy once each trace's
+// decision window elapses, and forwards sampled traces to a downstream
+// spanreceiver.SpanReceiver. It implements spanreceiver.SpanReceiver
+// itself, so it can be inserted wherever a SpanReceiver is expected.
+type Processor struct {
+	downstream     spanreceiver.SpanReceiver
+	policy         Policy
+	decisionWindow time.Duration
+
+	shards []*shard
+
+	lateSpans uint64 // atomic
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+var _ spanreceiver.SpanReceiver = (*Processor)(nil)
+
+// Option configures a Processor.
+type Option func(*Processor)
+
+// WithDecisionWindow overrides the default 10s window a trace is buffered
+// for before a sampling decision is made.
+func WithDecisionWindow(d time.Duration) Option {
+	return func(p *Processor) { p.decisionWindow = d }
+}
+
+// NewProcessor creates a Processor that applies policy to traces before
+// forwarding sampled ones to downstream.
+func NewProcessor(downstream spanreceiver.SpanReceiver, policy Policy, opts ...Option) *Processor {
+	p := &Processor{
+		downstream:     downstream,
+		policy:         policy,
+		decisionWindow: defaultDecisionWindow,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.shards = make([]*shard, defaultNumShards)
+	for i := range p.shards {
+		p.shards[i] = newShard()
+	}
+
+	p.done = make(chan struct{})
+	go p.sweepLoop()
+	return p
+}
+
+// Close stops the Processor's sweep loop. It is safe to call more than
+// once. A Processor whose Close is never called leaks its sweep goroutine
+// for the life of the process, so callers that recreate Processors (for
+// example on a config reload) must Close the old one.
+func (p *Processor) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	return nil
+}
+
+// LateSpans returns the number of spans that arrived for a trace whose
+// sampling decision had already been made and evicted from the buffer.
+func (p *Processor) LateSpans() uint64 {
+	return atomic.LoadUint64(&p.lateSpans)
+}
+
+// ReceiveSpans implements spanreceiver.SpanReceiver. Spans are grouped by
+// TraceId and buffered until their trace's decision window elapses.
+func (p *Processor) ReceiveSpans(node *commonpb.Node, spans ...*tracepb.Span) (*spanreceiver.Acknowledgement, error) {
+	byTrace := make(map[string][]*tracepb.Span)
+	for _, span := range spans {
+		key := string(span.GetTraceId())
+		byTrace[key] = append(byTrace[key], span)
+	}
+
+	for key, traceSpans := range byTrace {
+		p.shardFor(key).addSpans(p, key, node, traceSpans)
+	}
+
+	return &spanreceiver.Acknowledgement{SavedSpans: uint64(len(spans))}, nil
+}
+
+func (p *Processor) shardFor(traceIDKey string) *shard {
+	var h uint32
+	for i := 0; i < len(traceIDKey); i++ {
+		h = h*31 + uint32(traceIDKey[i])
+	}
+	return p.shards[int(h)%len(p.shards)]
+}
+
+func (p *Processor) decide(node *commonpb.Node, spans []*tracepb.Span) bool {
+	return p.policy.Sample(node, spans)
+}
+
+func (p *Processor) forward(node *commonpb.Node, spans []*tracepb.Span) {
+	_, _ = p.downstream.ReceiveSpans(node, spans...)
+}
+
+func (p *Processor) markLate(n int) {
+	atomic.AddUint64(&p.lateSpans, uint64(n))
+}
+
+// sweepInterval derives how often the sweep loop should run from the
+// configured decision window, so that a short WithDecisionWindow (as used
+// by tests) still gets decided promptly instead of waiting for a
+// hardcoded, decision-window-independent tick.
+func (p *Processor) sweepInterval() time.Duration {
+	interval := p.decisionWindow / 4
+	if interval > maxSweepInterval {
+		return maxSweepInterval
+	}
+	if interval < minSweepInterval {
+		return minSweepInterval
+	}
+	return interval
+}
+
+func (p *Processor) sweepLoop() {
+	ticker := time.NewTicker(p.sweepInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			for _, s := range p.shards {
+				s.sweep(p, now)
+			}
+		}
+	}
+}
+
+// traceBuffer tracks one trace's accumulated spans and, once decided, its
+// sampling outcome.
+type traceBuffer struct {
+	key       string
+	node      *commonpb.Node
+	spans     []*tracepb.Span
+	state     traceState
+	sampled   bool
+	expiresAt time.Time
+	heapIndex int
+}
+
+// shard owns a subset of traces behind its own mutex, plus a min-heap of
+// those traces ordered by expiresAt so the sweep loop can evict them in
+// order without scanning the whole map. evicted tombstones a trace for one
+// more decisionWindow after it's fully evicted from traces, purely so a
+// genuinely late span can be counted and dropped instead of silently
+// starting a brand-new, independently-sampled buffer for a trace ID that
+// was already decided.
+type shard struct {
+	mu      sync.Mutex
+	traces  map[string]*traceBuffer
+	expiry  traceHeap
+	evicted map[string]time.Time
+}
+
+func newShard() *shard {
+	return &shard{
+		traces:  make(map[string]*traceBuffer),
+		evicted: make(map[string]time.Time),
+	}
+}
+
+func (s *shard) addSpans(p *Processor, key string, node *commonpb.Node, spans []*tracepb.Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, wasEvicted := s.evicted[key]; wasEvicted {
+		p.markLate(len(spans))
+		return
+	}
+
+	tb, ok := s.traces[key]
+	if !ok {
+		tb = &traceBuffer{
+			key:       key,
+			node:      node,
+			state:     pending,
+			expiresAt: time.Now().Add(p.decisionWindow),
+		}
+		s.traces[key] = tb
+		heap.Push(&s.expiry, tb)
+	}
+
+	switch tb.state {
+	case pending:
+		tb.spans = append(tb.spans, spans...)
+	case decided:
+		// The decision window has passed but the trace hasn't been
+		// evicted yet: honor the cached decision instead of buffering.
+		if tb.sampled {
+			p.forward(node, spans)
+		}
+	}
+}
+
+type forwardItem struct {
+	node  *commonpb.Node
+	spans []*tracepb.Span
+}
+
+func (s *shard) sweep(p *Processor, now time.Time) {
+	s.mu.Lock()
+	var toForward []forwardItem
+	for s.expiry.Len() > 0 && !s.expiry[0].expiresAt.After(now) {
+		tb := heap.Pop(&s.expiry).(*traceBuffer)
+
+		switch tb.state {
+		case pending:
+			tb.sampled = p.decide(tb.node, tb.spans)
+			if tb.sampled {
+				toForward = append(toForward, forwardItem{node: tb.node, spans: tb.spans})
+			}
+			tb.state = decided
+			tb.expiresAt = now.Add(p.decisionWindow)
+			tb.spans = nil
+			heap.Push(&s.expiry, tb)
+		case decided:
+			delete(s.traces, tb.key)
+			s.evicted[tb.key] = now.Add(p.decisionWindow)
+		}
+	}
+
+	for key, expiresAt := range s.evicted {
+		if !expiresAt.After(now) {
+			delete(s.evicted, key)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, item := range toForward {
+		p.forward(item.node, item.spans)
+	}
+}
+
+// traceHeap is a container/heap.Interface over *traceBuffer ordered by
+// expiresAt, used to evict/decide the soonest-expiring traces first.
+type traceHeap []*traceBuffer
+
+func (h traceHeap) Len() int           { return len(h) }
+func (h traceHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h traceHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex, h[j].heapIndex = i, j
+}
+
+func (h *traceHeap) Push(x interface{}) {
+	tb := x.(*traceBuffer)
+	tb.heapIndex = len(*h)
+	*h = append(*h, tb)
+}
+
+func (h *traceHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	tb := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return tb
+}
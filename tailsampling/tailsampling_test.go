@@ -0,0 +1,139 @@
+// Copyright 2020, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsampling_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/census-instrumentation/opencensus-service/spanreceiver"
+	"github.com/census-instrumentation/opencensus-service/tailsampling"
+)
+
+func TestProcessor_sampleAndDrop(t *testing.T) {
+	sink := newSpanAppender()
+	policy := tailsampling.PolicyFunc(func(_ *commonpb.Node, spans []*tracepb.Span) bool {
+		return spans[0].GetStatus().GetCode() != 0
+	})
+	p := tailsampling.NewProcessor(sink, policy, tailsampling.WithDecisionWindow(50*time.Millisecond))
+
+	node := &commonpb.Node{}
+	errSpan := &tracepb.Span{TraceId: []byte("error-trace-0000"), Status: &tracepb.Status{Code: 2}}
+	okSpan := &tracepb.Span{TraceId: []byte("ok-trace-00000000"), Status: &tracepb.Status{Code: 0}}
+
+	if _, err := p.ReceiveSpans(node, errSpan, okSpan); err != nil {
+		t.Fatalf("ReceiveSpans failed: %v", err)
+	}
+
+	<-time.After(200 * time.Millisecond)
+
+	got := sink.spans()
+	if len(got) != 1 || string(got[0].TraceId) != string(errSpan.TraceId) {
+		t.Errorf("Expected only the errored trace to be sampled, got: %+v", got)
+	}
+}
+
+// A span arriving for a trace whose decision was already cached (but not
+// yet evicted) should be forwarded per that cached decision, without being
+// counted as late: the request calls this "honor the cached decision
+// instead of buffering", distinct from the late-span case below.
+func TestProcessor_decidedTraceHonorsCachedDecision(t *testing.T) {
+	sink := newSpanAppender()
+	policy := tailsampling.PolicyFunc(func(_ *commonpb.Node, _ []*tracepb.Span) bool { return true })
+	p := tailsampling.NewProcessor(sink, policy, tailsampling.WithDecisionWindow(40*time.Millisecond))
+
+	node := &commonpb.Node{}
+	span := &tracepb.Span{TraceId: []byte("cached-trace-0000")}
+
+	if _, err := p.ReceiveSpans(node, span); err != nil {
+		t.Fatalf("ReceiveSpans failed: %v", err)
+	}
+	// Past the first decision window (decided), well before the second one
+	// (evicted).
+	<-time.After(60 * time.Millisecond)
+
+	if _, err := p.ReceiveSpans(node, span); err != nil {
+		t.Fatalf("ReceiveSpans failed: %v", err)
+	}
+	<-time.After(20 * time.Millisecond)
+
+	if got := p.LateSpans(); got != 0 {
+		t.Errorf("LateSpans: got %d want 0; a still-cached decision isn't a late span", got)
+	}
+	if got := len(sink.spans()); got != 2 {
+		t.Errorf("Expected both spans to be forwarded per the cached decision, got %d", got)
+	}
+}
+
+// A span arriving after its trace's cached decision has itself been
+// evicted is genuinely late: it must be counted, dropped, and must not
+// silently reopen sampling (an independent second decision) for that
+// trace ID.
+func TestProcessor_lateSpanAfterEviction(t *testing.T) {
+	sink := newSpanAppender()
+	policy := tailsampling.PolicyFunc(func(_ *commonpb.Node, _ []*tracepb.Span) bool { return true })
+	p := tailsampling.NewProcessor(sink, policy, tailsampling.WithDecisionWindow(30*time.Millisecond))
+
+	node := &commonpb.Node{}
+	span := &tracepb.Span{TraceId: []byte("late-trace-000000")}
+
+	if _, err := p.ReceiveSpans(node, span); err != nil {
+		t.Fatalf("ReceiveSpans failed: %v", err)
+	}
+	// Past both the decision window and the eviction window that follows
+	// it.
+	<-time.After(80 * time.Millisecond)
+
+	if _, err := p.ReceiveSpans(node, span); err != nil {
+		t.Fatalf("ReceiveSpans failed: %v", err)
+	}
+	<-time.After(20 * time.Millisecond)
+
+	if got := p.LateSpans(); got != 1 {
+		t.Errorf("LateSpans: got %d want 1", got)
+	}
+	if got := len(sink.spans()); got != 1 {
+		t.Errorf("Expected the late span to be dropped rather than reopen sampling for its trace, got %d spans", got)
+	}
+}
+
+type spanAppender struct {
+	sync.Mutex
+	all []*tracepb.Span
+}
+
+func newSpanAppender() *spanAppender {
+	return &spanAppender{}
+}
+
+var _ spanreceiver.SpanReceiver = (*spanAppender)(nil)
+
+func (sa *spanAppender) ReceiveSpans(_ *commonpb.Node, spans ...*tracepb.Span) (*spanreceiver.Acknowledgement, error) {
+	sa.Lock()
+	defer sa.Unlock()
+	sa.all = append(sa.all, spans...)
+	return &spanreceiver.Acknowledgement{SavedSpans: uint64(len(spans))}, nil
+}
+
+func (sa *spanAppender) spans() []*tracepb.Span {
+	sa.Lock()
+	defer sa.Unlock()
+	out := make([]*tracepb.Span, len(sa.all))
+	copy(out, sa.all)
+	return out
+}